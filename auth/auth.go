@@ -0,0 +1,144 @@
+// Package auth provides the access-control layer for public_docs_server:
+// prefix-based visibility rules loaded from a YAML policy file, basic-auth
+// login against that same file, and signed, self-contained share links for
+// handing a single document to someone without an account.
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// User is the authenticated principal attached to a request. A nil *User
+// denotes an anonymous visitor; Policy rules with no Users listed still
+// allow them through.
+type User struct {
+	Name string `yaml:"-"`
+}
+
+// FilterFunc decides whether absPath is visible to user. A nil FilterFunc
+// (no policy configured) is treated by callers as allow-everything.
+type FilterFunc func(absPath string, user *User) bool
+
+// Rule restricts one path prefix to a set of named users. An empty Users
+// list means the prefix is visible to everyone, including anonymous
+// visitors.
+type Rule struct {
+	Prefix string   `yaml:"prefix"`
+	Users  []string `yaml:"users"`
+}
+
+// credential is one login's password, stored alongside the Policy it's
+// loaded from rather than in its own file so a single document describes
+// both who can log in and what they can see. Password is compared
+// byte-for-byte against the password the client sends at login; neither
+// side is hashed, so it holds the plaintext password itself.
+type credential struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+}
+
+// Policy is the parsed shape of a YAML access-control file:
+//
+//	rules:
+//	  - prefix: /restricted
+//	    users: [alice, bob]
+//	  - prefix: /
+//	    users: []
+//	users:
+//	  - name: alice
+//	    password: hunter2
+type Policy struct {
+	Rules []Rule       `yaml:"rules"`
+	Users []credential `yaml:"users"`
+}
+
+// LoadPolicy reads and parses a YAML policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file %s: %w", path, err)
+	}
+	var p Policy
+	if err := yaml.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy file %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Filter returns a FilterFunc backed by p's rules: the longest matching
+// prefix decides visibility, defaulting to allowed when nothing matches.
+func (p *Policy) Filter() FilterFunc {
+	return func(absPath string, user *User) bool {
+		var best *Rule
+		for i := range p.Rules {
+			r := &p.Rules[i]
+			if !matchesPrefix(absPath, r.Prefix) {
+				continue
+			}
+			if best == nil || len(r.Prefix) > len(best.Prefix) {
+				best = r
+			}
+		}
+		if best == nil || len(best.Users) == 0 {
+			return true
+		}
+		if user == nil {
+			return false
+		}
+		for _, name := range best.Users {
+			if name == user.Name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchesPrefix reports whether absPath is prefix itself or nested under
+// it, matching on whole path segments. A raw strings.HasPrefix would let
+// a rule for "/public" also match the unrelated sibling "/publicity";
+// requiring the boundary "/" after prefix rules that out.
+func matchesPrefix(absPath, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	trimmed := strings.TrimSuffix(prefix, "/")
+	return absPath == trimmed || strings.HasPrefix(absPath, trimmed+"/")
+}
+
+// Authenticate checks username/password against p's configured users,
+// returning the resolved User on success. The password comparison is
+// constant-time: HTTP Basic Auth exposes this to attacker-controlled
+// input on every request, and a == comparison would leak how many
+// leading bytes matched through response timing.
+func (p *Policy) Authenticate(username, password string) (*User, bool) {
+	for _, c := range p.Users {
+		if c.Name == username && subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1 {
+			return &User{Name: c.Name}, true
+		}
+	}
+	return nil, false
+}
+
+// UserFromRequest resolves the *User for r using HTTP Basic Auth
+// credentials, looked up via authenticate. It returns nil (anonymous)
+// when no credentials were supplied or they don't match; callers enforce
+// access separately via a FilterFunc, so an anonymous result is not
+// itself an error.
+func UserFromRequest(r *http.Request, authenticate func(username, password string) (*User, bool)) *User {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	user, ok := authenticate(username, password)
+	if !ok {
+		return nil
+	}
+	return user
+}
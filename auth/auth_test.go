@@ -0,0 +1,59 @@
+package auth
+
+import "testing"
+
+func TestMatchesPrefix(t *testing.T) {
+	cases := []struct {
+		absPath, prefix string
+		want            bool
+	}{
+		{"/public/a.txt", "/public", true},
+		{"/public", "/public", true},
+		{"/publicity/a.txt", "/public", false},
+		{"/anything", "/", true},
+		{"/restricted/sub/file", "/restricted/", true},
+		{"/other", "/restricted", false},
+	}
+	for _, c := range cases {
+		if got := matchesPrefix(c.absPath, c.prefix); got != c.want {
+			t.Errorf("matchesPrefix(%q, %q) = %v, want %v", c.absPath, c.prefix, got, c.want)
+		}
+	}
+}
+
+func TestPolicyFilter(t *testing.T) {
+	p := &Policy{
+		Rules: []Rule{
+			{Prefix: "/", Users: nil},
+			{Prefix: "/restricted", Users: []string{"alice"}},
+		},
+	}
+	filter := p.Filter()
+
+	if !filter("/public/readme.txt", nil) {
+		t.Errorf("expected an anonymous visitor to see an unrestricted path")
+	}
+	if filter("/restricted/secret.txt", nil) {
+		t.Errorf("expected an anonymous visitor to be denied a restricted path")
+	}
+	if !filter("/restricted/secret.txt", &User{Name: "alice"}) {
+		t.Errorf("expected alice to see a path her rule allows")
+	}
+	if filter("/restricted/secret.txt", &User{Name: "bob"}) {
+		t.Errorf("expected bob to be denied a path alice's rule doesn't list him in")
+	}
+}
+
+func TestPolicyAuthenticate(t *testing.T) {
+	p := &Policy{Users: []credential{{Name: "alice", Password: "hunter2"}}}
+
+	if _, ok := p.Authenticate("alice", "hunter2"); !ok {
+		t.Errorf("expected correct credentials to authenticate")
+	}
+	if _, ok := p.Authenticate("alice", "wrong"); ok {
+		t.Errorf("expected incorrect password to be rejected")
+	}
+	if _, ok := p.Authenticate("bob", "hunter2"); ok {
+		t.Errorf("expected unknown username to be rejected")
+	}
+}
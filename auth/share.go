@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SharePayload is the data encoded into a signed share link, granting
+// access to exactly the one path it names without requiring a login.
+type SharePayload struct {
+	Path         string    `json:"path"`
+	Expiry       time.Time `json:"expiry"`
+	DownloadOnly bool      `json:"download_only,omitempty"`
+}
+
+// SignShareLink encodes payload and signs it with secret, returning the
+// "<base64 payload>.<hmac>" token used in "/share/<token>" URLs. Both
+// halves are base64.RawURLEncoding, so the token is a single clean path
+// segment with no embedded slashes.
+func SignShareLink(payload SharePayload, secret []byte) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encoding share payload: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return encoded + "." + sign(encoded, secret), nil
+}
+
+// VerifyShareLink decodes and validates a token produced by SignShareLink,
+// rejecting it if the signature doesn't match secret or it has expired.
+func VerifyShareLink(token string, secret []byte) (*SharePayload, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed share token")
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(encoded, secret))) {
+		return nil, fmt.Errorf("invalid share token signature")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding share token: %w", err)
+	}
+	var payload SharePayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("decoding share payload: %w", err)
+	}
+	if time.Now().After(payload.Expiry) {
+		return nil, fmt.Errorf("share link expired")
+	}
+	return &payload, nil
+}
+
+func sign(encoded string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// DocSet manages a document tree backed by a git repository: one primary
+// checkout that's kept up to date by periodic fetches, plus an LRU of
+// on-demand worktrees checked out for specific commits or branch refs so
+// `/browse@<ref>/...` can show the tree as it was at any revision. Modeled
+// after the Skia docserver's single-clone-many-worktrees approach. Uses
+// go-git so no external git binary is required.
+type DocSet struct {
+	mu sync.Mutex
+
+	repo       *git.Repository
+	primaryDir string
+	cacheDir   string
+
+	maxWorktrees int
+	worktrees    map[string]string // resolved commit hash -> checked-out directory
+	lru          []string          // hashes in least- to most-recently-used order
+}
+
+// NewDocSet opens (cloning if necessary) repoURL into cacheDir/primary and
+// returns a DocSet ready to serve that primary checkout and resolve
+// on-demand worktrees for other refs, keeping at most maxWorktrees of the
+// latter checked out at once.
+func NewDocSet(repoURL, cacheDir string, maxWorktrees int) (*DocSet, error) {
+	primaryDir := filepath.Join(cacheDir, "primary")
+
+	repo, err := git.PlainOpen(primaryDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		log.Printf("Cloning %s into %s", repoURL, primaryDir)
+		repo, err = git.PlainClone(primaryDir, false, &git.CloneOptions{URL: repoURL})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening document repository: %w", err)
+	}
+
+	return &DocSet{
+		repo:         repo,
+		primaryDir:   primaryDir,
+		cacheDir:     cacheDir,
+		maxWorktrees: maxWorktrees,
+		worktrees:    make(map[string]string),
+	}, nil
+}
+
+// PrimaryDir is the directory the primary checkout (HEAD of the tracked
+// branch) lives in.
+func (ds *DocSet) PrimaryDir() string {
+	return ds.primaryDir
+}
+
+// StartAutoFetch fetches origin every interval, fast-forwards the primary
+// checkout, and calls onUpdate (if non-nil) whenever the fetch brought in
+// new commits, so the caller can re-run its document scan.
+func (ds *DocSet) StartAutoFetch(interval time.Duration, onUpdate func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			updated, err := ds.fetchAndUpdatePrimary()
+			if err != nil {
+				log.Printf("DocSet: fetch failed: %v", err)
+				continue
+			}
+			if updated && onUpdate != nil {
+				onUpdate()
+			}
+		}
+	}()
+}
+
+// fetchAndUpdatePrimary fetches and fast-forwards the primary checkout.
+// It takes ds.mu for its whole duration, the same lock Resolve holds
+// while resolving/checking out a worktree, since both paths read and
+// write ds.repo's shared object store and ds.mu is what serializes them.
+func (ds *DocSet) fetchAndUpdatePrimary() (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	err := ds.repo.Fetch(&git.FetchOptions{RemoteName: "origin"})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return false, err
+	}
+	fetchedNew := err == nil
+
+	wt, err := ds.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	err = wt.Pull(&git.PullOptions{RemoteName: "origin"})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return false, err
+	}
+	return fetchedNew, nil
+}
+
+// Resolve returns the directory on disk holding the document tree as of
+// ref. An empty ref (or "HEAD") resolves to the primary checkout; any
+// other ref (branch, tag, or commit hash) is checked out on demand into
+// its own worktree, reused on subsequent calls until evicted by the LRU.
+// The worktree is cached by the resolved commit hash rather than the raw
+// ref string, so two refs pointing at the same commit (e.g. a tag cut at
+// a branch tip) share one on-disk checkout instead of the second one
+// failing to re-clone over the first.
+func (ds *DocSet) Resolve(ref string) (string, error) {
+	if ref == "" || ref == "HEAD" {
+		return ds.primaryDir, nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	hash, err := ds.resolveHashLocked(ref)
+	if err != nil {
+		return "", err
+	}
+	key := hash.String()
+
+	if dir, ok := ds.worktrees[key]; ok {
+		ds.touchLocked(key)
+		return dir, nil
+	}
+
+	dir, err := ds.checkoutWorktreeLocked(hash)
+	if err != nil {
+		return "", err
+	}
+	ds.worktrees[key] = dir
+	ds.lru = append(ds.lru, key)
+	ds.evictLocked()
+	return dir, nil
+}
+
+// resolveHashLocked resolves ref to a commit hash. go-git's shorthand
+// revision resolution tries the local branch/tag namespaces but not
+// refs/remotes/origin/<ref> for a bare branch name, even though
+// PlainClone fetches every branch in under that namespace - only the
+// fully qualified "origin/<ref>" resolves. Falling back to that lets a
+// plain branch name like "feature-branch" work without the caller needing
+// to already know to spell it "origin/feature-branch". Caller must hold
+// ds.mu.
+func (ds *DocSet) resolveHashLocked(ref string) (plumbing.Hash, error) {
+	hash, err := ds.repo.ResolveRevision(plumbing.Revision(ref))
+	if err == nil {
+		return *hash, nil
+	}
+	if hash, err2 := ds.repo.ResolveRevision(plumbing.Revision("origin/" + ref)); err2 == nil {
+		return *hash, nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("resolving ref %q: %w", ref, err)
+}
+
+// checkoutWorktreeLocked checks hash out into its own directory, with its
+// own independent object store. Caller must hold ds.mu.
+func (ds *DocSet) checkoutWorktreeLocked(hash plumbing.Hash) (string, error) {
+	dir := filepath.Join(ds.cacheDir, "worktrees", hash.String())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating worktree dir: %w", err)
+	}
+
+	// Clone into its own Storer/HEAD rather than sharing the primary
+	// checkout's: go-git's Worktree.Checkout mutates HEAD, so two
+	// checkouts sharing a Storer would stomp on each other and detach the
+	// primary checkout's HEAD out from under it.
+	wtRepo, err := git.PlainClone(dir, false, &git.CloneOptions{URL: ds.primaryDir})
+	if err != nil {
+		return "", fmt.Errorf("cloning worktree repository: %w", err)
+	}
+	wt, err := wtRepo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("getting worktree: %w", err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return "", fmt.Errorf("checking out %s: %w", hash, err)
+	}
+
+	return dir, nil
+}
+
+// touchLocked marks key (a resolved commit hash) as most-recently-used.
+// Caller must hold ds.mu.
+func (ds *DocSet) touchLocked(key string) {
+	for i, k := range ds.lru {
+		if k == key {
+			ds.lru = append(ds.lru[:i], ds.lru[i+1:]...)
+			break
+		}
+	}
+	ds.lru = append(ds.lru, key)
+}
+
+// evictLocked removes the least-recently-used worktrees until at most
+// ds.maxWorktrees remain. Caller must hold ds.mu.
+func (ds *DocSet) evictLocked() {
+	for len(ds.lru) > ds.maxWorktrees {
+		oldest := ds.lru[0]
+		ds.lru = ds.lru[1:]
+		dir, ok := ds.worktrees[oldest]
+		delete(ds.worktrees, oldest)
+		if ok {
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("DocSet: error evicting worktree %s: %v", oldest, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	_ "github.com/go-git/go-git/v5/plumbing/transport/file"
+)
+
+// newTestOriginRepo creates a local git repository with one commit, a
+// lightweight tag and a branch both pointing at that commit, so Resolve can
+// be exercised against two distinct refs that share an underlying commit.
+func newTestOriginRepo(t *testing.T) (dir string, commit plumbing.Hash) {
+	t.Helper()
+	dir = t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("writing seed file: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+	if _, err := wt.Add("a.txt"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)}
+	commit, err = wt.Commit("seed", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if _, err := repo.CreateTag("v1", commit, nil); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), commit)); err != nil {
+		t.Fatalf("creating feature branch: %v", err)
+	}
+
+	return dir, commit
+}
+
+func TestDocSetResolveHEAD(t *testing.T) {
+	origin, _ := newTestOriginRepo(t)
+	ds, err := NewDocSet(origin, t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewDocSet: %v", err)
+	}
+	dir, err := ds.Resolve("")
+	if err != nil {
+		t.Fatalf("Resolve(\"\"): %v", err)
+	}
+	if dir != ds.PrimaryDir() {
+		t.Errorf("Resolve(\"\") = %s, want primary dir %s", dir, ds.PrimaryDir())
+	}
+	if dir, err := ds.Resolve("HEAD"); err != nil || dir != ds.PrimaryDir() {
+		t.Errorf("Resolve(\"HEAD\") = (%s, %v), want (%s, nil)", dir, err, ds.PrimaryDir())
+	}
+}
+
+func TestDocSetResolveSharesWorktreeForSameCommit(t *testing.T) {
+	origin, commit := newTestOriginRepo(t)
+	ds, err := NewDocSet(origin, t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewDocSet: %v", err)
+	}
+
+	tagDir, err := ds.Resolve("v1")
+	if err != nil {
+		t.Fatalf("Resolve(\"v1\"): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tagDir, "a.txt")); err != nil {
+		t.Fatalf("expected worktree to contain checked-out files: %v", err)
+	}
+
+	// "feature" is only reachable via refs/remotes/origin/feature since it
+	// was never checked out locally by the clone; Resolve must fall back to
+	// that to find it.
+	branchDir, err := ds.Resolve("feature")
+	if err != nil {
+		t.Fatalf("Resolve(\"feature\"): %v", err)
+	}
+
+	if branchDir != tagDir {
+		t.Errorf("expected \"v1\" and \"feature\" (same commit %s) to share one worktree, got %s and %s", commit, tagDir, branchDir)
+	}
+	if len(ds.worktrees) != 1 {
+		t.Errorf("expected exactly one cached worktree for the shared commit, got %d", len(ds.worktrees))
+	}
+}
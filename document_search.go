@@ -1,82 +1,180 @@
 package main
 
 import (
+	"bytes"
+	"encoding/gob"
+	"html"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ledongthuc/pdf"
 )
 
-// DocumentIndex represents the in-memory index of documents
+// DocumentIndex represents the in-memory index of documents, both their
+// names (for ID-prefix lookups) and their extracted text content (for
+// full-text substring search).
 type DocumentIndex struct {
-	mu       sync.RWMutex
-	documents map[string][]DocumentInfo
+	mu sync.RWMutex
+
+	documents map[string][]DocumentInfo // doc name -> occurrences
+	byPath    map[string]DocumentInfo   // full path -> doc info
+
+	content  map[string]docContent // full path -> extracted text + mtime
+	suffixes []suffixEntry         // alphabetically sorted suffix array over every token, for substring search
+
 	lastScan time.Time
+
+	// indexFile is where the index is persisted between runs so a restart
+	// doesn't require re-extracting every PDF from scratch.
+	indexFile string
+}
+
+// docContent holds the extracted plain text for a document together with
+// the mtime it was extracted at, so scanDocuments can tell whether the
+// file changed since the last scan without re-reading unchanged files.
+type docContent struct {
+	Text    string
+	ModTime time.Time
+}
+
+// suffixEntry is one entry of the suffix array: Suffix is a suffix of a
+// single indexed token (e.g. token "421321" contributes, among others,
+// the suffix "21321" at Offset one past the token's start). Sorting these
+// alphabetically turns a substring query into a binary search for the
+// range of suffixes having it as a prefix, so "213" matches inside
+// "421321" and "plan" matches inside "planning" even though neither is a
+// whole token.
+type suffixEntry struct {
+	Suffix string
+	Doc    string
+	Offset int
 }
+
 // DocumentInfo represents information about a found document
 type DocumentInfo struct {
-	ID       string `json:"id"`
-	Path     string `json:"path"`
-	Name     string `json:"name"`
-	Size     int64  `json:"size"`
-	ModTime  time.Time `json:"mod_time"`
-	FullPath string `json:"full_path"`
+	ID           string    `json:"id"`
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"mod_time"`
+	FullPath     string    `json:"full_path"`
+	RelativePath string    `json:"relative_path"`
+
+	// Populated only by content search (SearchContent); zero value for the
+	// plain ID-prefix search.
+	Snippet string  `json:"snippet,omitempty"`
+	Offset  int     `json:"offset,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+
+	// Origin names the instance a hit came from; populated only by
+	// federated search (Federator.FederatedSearch).
+	Origin string `json:"origin,omitempty"`
 }
+
 // SearchResult represents the result of a document search
 type SearchResult struct {
-	Query     string         `json:"query"`
-	Results   []DocumentInfo `json:"results"`
-	Count     int            `json:"count"`
-	SearchTime time.Time     `json:"search_time"`
+	Query      string         `json:"query"`
+	Results    []DocumentInfo `json:"results"`
+	Count      int            `json:"count"`
+	SearchTime time.Time      `json:"search_time"`
 }
-// NewDocumentIndex creates a new document index
-func NewDocumentIndex() *DocumentIndex {
+
+// persistedIndex is the on-disk shape of a DocumentIndex, written with
+// encoding/gob so restarts can skip re-extracting unchanged files.
+type persistedIndex struct {
+	Documents map[string][]DocumentInfo
+	Content   map[string]docContent
+	Suffixes  []suffixEntry
+	LastScan  time.Time
+}
+
+// tokenRe splits extracted text into indexable tokens (letters and digits).
+var tokenRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// NewDocumentIndex creates a new document index. indexFile, if non-empty,
+// is where the index is persisted between runs via SaveIndex/LoadIndex.
+func NewDocumentIndex(indexFile string) *DocumentIndex {
 	return &DocumentIndex{
 		documents: make(map[string][]DocumentInfo),
+		byPath:    make(map[string]DocumentInfo),
+		content:   make(map[string]docContent),
 		lastScan:  time.Time{},
+		indexFile: indexFile,
 	}
 }
+
 // StartIndexing starts the background indexing process
-func (di *DocumentIndex) StartIndexing(rootPath string) {
+func (di *DocumentIndex) StartIndexing(fsys FileSystem, rootPath string) {
+	if err := di.LoadIndex(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading persisted index: %v", err)
+	}
 	go func() {
 		// Initial scan
-		di.scanDocuments(rootPath)
+		di.scanDocuments(fsys, rootPath)
 		// Periodic refresh every 10 minutes
 		ticker := time.NewTicker(10 * time.Minute)
 		defer ticker.Stop()
 		for range ticker.C {
-			di.scanDocuments(rootPath)
+			di.scanDocuments(fsys, rootPath)
 		}
 	}()
 }
-// scanDocuments scans the directory recursively and indexes documents
-func (di *DocumentIndex) scanDocuments(rootPath string) {
-	di.mu.Lock()
-	defer di.mu.Unlock()
-	// Clear existing index
-	di.documents = make(map[string][]DocumentInfo)
-	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error accessing path %s: %v", path, err)
-			return nil // Continue walking
-		}
+
+// scanDocuments walks the document tree (a plain directory or a mounted
+// archive, through the FileSystem interface) and indexes documents. Text
+// extraction for new or changed files (e.g. parsing a PDF) runs without
+// holding di.mu, so concurrent searches aren't blocked for the duration of
+// a slow extraction; di.mu is only taken briefly at the end to swap in the
+// freshly built index.
+func (di *DocumentIndex) scanDocuments(fsys FileSystem, rootPath string) {
+	di.mu.RLock()
+	previousContent := di.content
+	di.mu.RUnlock()
+
+	newDocuments := make(map[string][]DocumentInfo)
+	newByPath := make(map[string]DocumentInfo)
+	newContent := make(map[string]docContent)
+
+	err := WalkFS(fsys, rootPath, func(p string, info os.FileInfo) error {
 		if info.IsDir() {
 			return nil // Skip directories
 		}
 		docName := info.Name()
-		if docName != "" {
-			relPath, _ := filepath.Rel(rootPath, path)
-			docInfo := DocumentInfo{
-				ID:       docName,
-				Path:     relPath,
-				Name:     info.Name(),
-				Size:     info.Size(),
-				ModTime:  info.ModTime(),
-				FullPath: path,
-			}
-			di.documents[docName] = append(di.documents[docName], docInfo)
+		if docName == "" {
+			return nil
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(p, rootPath), "/")
+		docInfo := DocumentInfo{
+			ID:           docName,
+			Path:         relPath,
+			Name:         info.Name(),
+			Size:         info.Size(),
+			ModTime:      info.ModTime(),
+			FullPath:     p,
+			RelativePath: relPath,
+		}
+		newDocuments[docName] = append(newDocuments[docName], docInfo)
+		newByPath[p] = docInfo
+
+		if existing, ok := previousContent[p]; ok && existing.ModTime.Equal(info.ModTime()) {
+			newContent[p] = existing // unchanged since last scan, keep the cached extraction
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(p))
+		text, err := extractText(fsys, p, ext)
+		if err != nil {
+			log.Printf("Error extracting text from %s: %v", p, err)
+			return nil
+		}
+		if text != "" {
+			newContent[p] = docContent{Text: text, ModTime: info.ModTime()}
 		}
 		return nil
 	})
@@ -84,11 +182,59 @@ func (di *DocumentIndex) scanDocuments(rootPath string) {
 		log.Printf("Error during document scan: %v", err)
 		return
 	}
+
+	newSuffixes := buildSuffixIndex(newContent)
+
+	di.mu.Lock()
+	di.documents = newDocuments
+	di.byPath = newByPath
+	di.content = newContent
+	di.suffixes = newSuffixes
 	di.lastScan = time.Now()
+	di.mu.Unlock()
+
+	if err := di.SaveIndex(); err != nil {
+		log.Printf("Error persisting document index: %v", err)
+	}
+}
+
+// buildSuffixIndex builds the alphabetically sorted suffix array used for
+// substring search over every token in content.
+func buildSuffixIndex(content map[string]docContent) []suffixEntry {
+	var entries []suffixEntry
+	for docPath, c := range content {
+		lower := strings.ToLower(c.Text)
+		for _, m := range tokenRe.FindAllStringIndex(lower, -1) {
+			token := lower[m[0]:m[1]]
+			for i := range token {
+				entries = append(entries, suffixEntry{Suffix: token[i:], Doc: docPath, Offset: m[0] + i})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Suffix < entries[j].Suffix })
+	return entries
+}
+
+// matchSubstringLocked returns every offset at which token occurs as a
+// substring anywhere in the indexed text, grouped by document path, found
+// via binary search over the sorted suffix array. Caller must hold di.mu
+// (read or write).
+func (di *DocumentIndex) matchSubstringLocked(token string) map[string][]int {
+	lo := sort.Search(len(di.suffixes), func(i int) bool { return di.suffixes[i].Suffix >= token })
+
+	matches := make(map[string][]int)
+	for i := lo; i < len(di.suffixes) && strings.HasPrefix(di.suffixes[i].Suffix, token); i++ {
+		e := di.suffixes[i]
+		matches[e.Doc] = append(matches[e.Doc], e.Offset)
+	}
+	return matches
 }
 
-// SearchDocuments searches for documents by ID
-func (di *DocumentIndex) SearchDocuments(query string) *SearchResult {
+// SearchDocuments searches for documents by ID. allowed, if non-nil, is
+// consulted with each candidate's FullPath and excludes hidden documents
+// from the results so access-restricted directories never leak through
+// search; pass nil to search without any visibility restriction.
+func (di *DocumentIndex) SearchDocuments(query string, allowed func(fullPath string) bool) *SearchResult {
 	di.mu.RLock()
 	defer di.mu.RUnlock()
 	query = strings.TrimSpace(query)
@@ -102,10 +248,80 @@ func (di *DocumentIndex) SearchDocuments(query string) *SearchResult {
 	}
 	var results []DocumentInfo
 	for docID, docs := range di.documents {
-		if strings.HasPrefix(docID, query) {
-			results = append(results, docs...)
+		if !strings.HasPrefix(docID, query) {
+			continue
+		}
+		for _, doc := range docs {
+			if allowed == nil || allowed(doc.FullPath) {
+				results = append(results, doc)
+			}
+		}
+	}
+	return &SearchResult{
+		Query:      query,
+		Results:    results,
+		Count:      len(results),
+		SearchTime: time.Now(),
+	}
+}
+
+// SearchContent runs a ranked full-text search over the indexed document
+// contents. When withSnippet is true, each hit's Snippet/Offset fields are
+// populated with the first matching passage, terms wrapped in <mark>.
+// allowed, if non-nil, is consulted with each candidate's FullPath and
+// excludes hidden documents from the results; pass nil to search without
+// any visibility restriction.
+func (di *DocumentIndex) SearchContent(query string, withSnippet bool, allowed func(fullPath string) bool) *SearchResult {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return &SearchResult{Query: query, Results: []DocumentInfo{}, SearchTime: time.Now()}
+	}
+
+	tokens := tokenRe.FindAllString(strings.ToLower(query), -1)
+	if len(tokens) == 0 {
+		return &SearchResult{Query: query, Results: []DocumentInfo{}, SearchTime: time.Now()}
+	}
+
+	scores := make(map[string]float64)
+	firstOffset := make(map[string]int)
+	for _, tok := range tokens {
+		for docPath, offsets := range di.matchSubstringLocked(tok) {
+			scores[docPath] += float64(len(offsets))
+			for _, o := range offsets {
+				if off, ok := firstOffset[docPath]; !ok || o < off {
+					firstOffset[docPath] = o
+				}
+			}
+		}
+	}
+
+	results := make([]DocumentInfo, 0, len(scores))
+	for path, score := range scores {
+		if allowed != nil && !allowed(path) {
+			continue
+		}
+		doc, ok := di.byPath[path]
+		if !ok {
+			continue
 		}
+		doc.Score = score
+		doc.Offset = firstOffset[path]
+		if withSnippet {
+			doc.Snippet = di.buildSnippetLocked(path, doc.Offset, tokens)
+		}
+		results = append(results, doc)
 	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ModTime.After(results[j].ModTime)
+	})
+
 	return &SearchResult{
 		Query:      query,
 		Results:    results,
@@ -113,6 +329,35 @@ func (di *DocumentIndex) SearchDocuments(query string) *SearchResult {
 		SearchTime: time.Now(),
 	}
 }
+
+// buildSnippetLocked extracts a short, HTML-escaped passage of text around
+// offset with every occurrence of tokens wrapped in <mark>. Caller must
+// hold di.mu (read or write).
+func (di *DocumentIndex) buildSnippetLocked(path string, offset int, tokens []string) string {
+	c, ok := di.content[path]
+	if !ok {
+		return ""
+	}
+	text := c.Text
+
+	const radius = 60
+	start := offset - radius
+	if start < 0 {
+		start = 0
+	}
+	end := offset + radius
+	if end > len(text) {
+		end = len(text)
+	}
+
+	snippet := html.EscapeString(text[start:end])
+	for _, tok := range tokens {
+		re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(tok))
+		snippet = re.ReplaceAllString(snippet, "<mark>$0</mark>")
+	}
+	return strings.TrimSpace(snippet)
+}
+
 // GetIndexStats returns statistics about the document index
 func (di *DocumentIndex) GetIndexStats() map[string]interface{} {
 	di.mu.RLock()
@@ -124,12 +369,143 @@ func (di *DocumentIndex) GetIndexStats() map[string]interface{} {
 	return map[string]interface{}{
 		"unique_ids":    len(di.documents),
 		"total_files":   totalDocs,
+		"indexed_files": len(di.content),
 		"last_scan":     di.lastScan,
 		"index_age":     time.Since(di.lastScan).String(),
 	}
 }
+
 // ForceRefresh forces an immediate refresh of the document index
-func (di *DocumentIndex) ForceRefresh(rootPath string) {
+func (di *DocumentIndex) ForceRefresh(fsys FileSystem, rootPath string) {
 	log.Printf("Forcing document index refresh")
-	di.scanDocuments(rootPath)
-} 
\ No newline at end of file
+	di.scanDocuments(fsys, rootPath)
+}
+
+// SaveIndex persists the current index to di.indexFile so a restart can
+// skip re-extracting unchanged files.
+func (di *DocumentIndex) SaveIndex() error {
+	if di.indexFile == "" {
+		return nil
+	}
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	f, err := os.Create(di.indexFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewEncoder(f).Encode(persistedIndex{
+		Documents: di.documents,
+		Content:   di.content,
+		Suffixes:  di.suffixes,
+		LastScan:  di.lastScan,
+	})
+}
+
+// LoadIndex restores a previously persisted index from di.indexFile, if
+// any. The next scanDocuments call will re-extract only files whose mtime
+// has since changed.
+func (di *DocumentIndex) LoadIndex() error {
+	if di.indexFile == "" {
+		return nil
+	}
+	f, err := os.Open(di.indexFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var p persistedIndex
+	if err := gob.NewDecoder(f).Decode(&p); err != nil {
+		return err
+	}
+
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	di.documents = p.Documents
+	di.content = p.Content
+	di.suffixes = p.Suffixes
+	di.lastScan = p.LastScan
+
+	di.byPath = make(map[string]DocumentInfo, len(di.documents))
+	for _, docs := range di.documents {
+		for _, d := range docs {
+			di.byPath[d.FullPath] = d
+		}
+	}
+	return nil
+}
+
+// extractText reads the plain-text content of p for indexing, dispatching
+// on its (lowercased) extension. p is read through fsys so content inside
+// mounted archives is indexed exactly like content on disk. An empty
+// string with a nil error means the extension isn't indexable.
+func extractText(fsys FileSystem, p, ext string) (string, error) {
+	switch ext {
+	case ".pdf":
+		return extractPDFText(fsys, p)
+	case ".txt", ".md":
+		raw, err := readAll(fsys, p)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	case ".html", ".htm":
+		raw, err := readAll(fsys, p)
+		if err != nil {
+			return "", err
+		}
+		return stripHTMLTags(string(raw)), nil
+	default:
+		return "", nil
+	}
+}
+
+func readAll(fsys FileSystem, p string) ([]byte, error) {
+	rc, err := fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// extractPDFText concatenates the plain text of every page in a PDF file.
+// The whole file is buffered into memory first since pdf.NewReader needs
+// random access, which archive members mounted through fsys don't offer.
+func extractPDFText(fsys FileSystem, p string) (string, error) {
+	raw, err := readAll(fsys, p)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := pdf.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	totalPage := r.NumPage()
+	for i := 1; i <= totalPage; i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			continue // skip pages we can't decode rather than failing the whole document
+		}
+		buf.WriteString(text)
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+var htmlTagRe = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// stripHTMLTags removes markup so HTML files can be indexed as plain text.
+func stripHTMLTags(raw string) string {
+	return htmlTagRe.ReplaceAllString(raw, " ")
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestBuildSuffixIndexAndMatchSubstring(t *testing.T) {
+	content := map[string]docContent{
+		"/a.txt": {Text: "quarterly planning document"},
+		"/b.txt": {Text: "421321 is the part number"},
+	}
+	di := &DocumentIndex{suffixes: buildSuffixIndex(content)}
+
+	matches := di.matchSubstringLocked("plan")
+	offsets, ok := matches["/a.txt"]
+	if !ok {
+		t.Fatalf("expected a match in /a.txt, got %v", matches)
+	}
+	if len(offsets) != 1 || offsets[0] != 10 {
+		t.Errorf("expected offset [10] for \"plan\" inside \"planning\", got %v", offsets)
+	}
+
+	matches = di.matchSubstringLocked("213")
+	offsets, ok = matches["/b.txt"]
+	if !ok || len(offsets) != 1 || offsets[0] != 1 {
+		t.Errorf("expected substring \"213\" inside \"421321\" at offset 1, got %v (ok=%v)", offsets, ok)
+	}
+
+	if matches := di.matchSubstringLocked("nope"); len(matches) != 0 {
+		t.Errorf("expected no matches for an absent token, got %v", matches)
+	}
+}
+
+func TestSearchContentScoringAndSnippet(t *testing.T) {
+	di := NewDocumentIndex("")
+	di.content = map[string]docContent{
+		"/docs/a.txt": {Text: "the invoice total is due at the end of the month"},
+		"/docs/b.txt": {Text: "invoice invoice invoice"},
+	}
+	di.byPath = map[string]DocumentInfo{
+		"/docs/a.txt": {FullPath: "/docs/a.txt", Name: "a.txt"},
+		"/docs/b.txt": {FullPath: "/docs/b.txt", Name: "b.txt"},
+	}
+	di.suffixes = buildSuffixIndex(di.content)
+
+	result := di.SearchContent("invoice", true, nil)
+	if result.Count != 2 {
+		t.Fatalf("expected 2 hits, got %d: %+v", result.Count, result.Results)
+	}
+	// b.txt has 3 occurrences of "invoice" vs a.txt's 1, so it should score higher and sort first.
+	if result.Results[0].FullPath != "/docs/b.txt" {
+		t.Errorf("expected /docs/b.txt ranked first by score, got %s", result.Results[0].FullPath)
+	}
+	if result.Results[0].Snippet == "" {
+		t.Errorf("expected a non-empty snippet when withSnippet is true")
+	}
+
+	filtered := di.SearchContent("invoice", false, func(fullPath string) bool { return fullPath == "/docs/a.txt" })
+	if filtered.Count != 1 || filtered.Results[0].FullPath != "/docs/a.txt" {
+		t.Errorf("expected allowed filter to restrict results to /docs/a.txt, got %+v", filtered.Results)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Peer describes one sibling public_docs_server instance that federated
+// search queries are fanned out to.
+type Peer struct {
+	Name    string        `json:"name"`
+	URL     string        `json:"url"`
+	Timeout time.Duration `json:"-"`
+	Weight  float64       `json:"weight"`
+	Token   string        `json:"token,omitempty"`
+}
+
+// peerConfig is the on-disk JSON shape of a Peer; Timeout is written as a
+// duration string (e.g. "5s") rather than raw nanoseconds.
+type peerConfig struct {
+	Name    string  `json:"name"`
+	URL     string  `json:"url"`
+	Timeout string  `json:"timeout"`
+	Weight  float64 `json:"weight"`
+	Token   string  `json:"token,omitempty"`
+}
+
+// FederationConfig is the JSON file describing the peers to federate
+// search queries to.
+type FederationConfig struct {
+	Peers []Peer
+}
+
+// LoadFederationConfig reads a FederationConfig from a JSON file shaped
+// like:
+//
+//	{"peers": [{"name": "shop-floor-2", "url": "http://10.0.0.2:8080", "timeout": "5s", "weight": 1}]}
+func LoadFederationConfig(path string) (*FederationConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading federation config %s: %w", path, err)
+	}
+
+	var doc struct {
+		Peers []peerConfig `json:"peers"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parsing federation config %s: %w", path, err)
+	}
+
+	cfg := &FederationConfig{Peers: make([]Peer, 0, len(doc.Peers))}
+	for _, p := range doc.Peers {
+		timeout := 5 * time.Second
+		if p.Timeout != "" {
+			timeout, err = time.ParseDuration(p.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("peer %s: invalid timeout %q: %w", p.Name, p.Timeout, err)
+			}
+		}
+		cfg.Peers = append(cfg.Peers, Peer{
+			Name:    p.Name,
+			URL:     p.URL,
+			Timeout: timeout,
+			Weight:  p.Weight,
+			Token:   p.Token,
+		})
+	}
+	return cfg, nil
+}
+
+// PeerError records a peer that failed to answer a federated query.
+type PeerError struct {
+	Peer  string `json:"peer"`
+	Error string `json:"error"`
+}
+
+// FederatedSearchResult is the merged response of a federated search: the
+// deduplicated, origin-tagged hits from every reachable peer (and the
+// local instance), plus the list of peers that failed to answer.
+type FederatedSearchResult struct {
+	Query      string         `json:"query"`
+	Results    []DocumentInfo `json:"results"`
+	Count      int            `json:"count"`
+	Errors     []PeerError    `json:"errors,omitempty"`
+	SearchTime time.Time      `json:"search_time"`
+}
+
+// Federator fans a search query out to a set of peer public_docs_server
+// instances and merges the results with the local index.
+type Federator struct {
+	local      *DocumentIndex
+	localName  string
+	peers      []Peer
+	httpClient *http.Client
+}
+
+// NewFederator returns a Federator that always searches local in addition
+// to the configured peers.
+func NewFederator(local *DocumentIndex, localName string, peers []Peer) *Federator {
+	return &Federator{
+		local:      local,
+		localName:  localName,
+		peers:      peers,
+		httpClient: &http.Client{},
+	}
+}
+
+// FederatedSearch queries the local index and every configured peer
+// concurrently, each under its own timeout, and merges the results.
+// Peers that error or time out are recorded in Errors rather than
+// failing the whole request. allowed restricts the local search to the
+// requesting user's visible documents; it has no effect on peers, which
+// enforce their own access control on the hits they return.
+func (f *Federator) FederatedSearch(ctx context.Context, query string, withSnippet bool, allowed func(fullPath string) bool) *FederatedSearchResult {
+	type hit struct {
+		docs []DocumentInfo
+		err  *PeerError
+	}
+
+	results := make([]hit, 1+len(f.peers))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		local := f.local.SearchContent(query, withSnippet, allowed)
+		for i := range local.Results {
+			local.Results[i].Origin = f.localName
+		}
+		results[0] = hit{docs: local.Results}
+	}()
+
+	for i, peer := range f.peers {
+		i, peer := i, peer
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			docs, err := f.queryPeer(ctx, peer, query, withSnippet)
+			if err != nil {
+				results[1+i] = hit{err: &PeerError{Peer: peer.Name, Error: err.Error()}}
+				return
+			}
+			results[1+i] = hit{docs: docs}
+		}()
+	}
+	wg.Wait()
+
+	merged := make(map[string]DocumentInfo)
+	var errs []PeerError
+	for _, h := range results {
+		if h.err != nil {
+			errs = append(errs, *h.err)
+			continue
+		}
+		for _, doc := range h.docs {
+			mergeDocumentHit(merged, doc)
+		}
+	}
+
+	docs := make([]DocumentInfo, 0, len(merged))
+	for _, d := range merged {
+		docs = append(docs, d)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Score != docs[j].Score {
+			return docs[i].Score > docs[j].Score
+		}
+		return docs[i].ModTime.After(docs[j].ModTime)
+	})
+
+	return &FederatedSearchResult{
+		Query:      query,
+		Results:    docs,
+		Count:      len(docs),
+		Errors:     errs,
+		SearchTime: time.Now(),
+	}
+}
+
+// mergeDocumentHit folds doc into merged, keyed by Origin+FullPath. doc.ID
+// is just the bare filename, so two distinct documents that happen to
+// share a name (even within a single peer's own results, e.g. two files
+// named "manual.pdf" in different folders) would otherwise collide and
+// silently drop one hit; Origin+FullPath uniquely identifies a document
+// within one instance's tree.
+func mergeDocumentHit(merged map[string]DocumentInfo, doc DocumentInfo) {
+	key := doc.Origin + "\x00" + doc.FullPath
+	existing, ok := merged[key]
+	if !ok {
+		merged[key] = doc
+		return
+	}
+	if doc.ModTime.After(existing.ModTime) || (doc.ModTime.Equal(existing.ModTime) && doc.Size > existing.Size) {
+		merged[key] = doc
+	}
+}
+
+// queryPeer performs one /api/search request against peer and decodes its
+// SearchResult.
+func (f *Federator) queryPeer(ctx context.Context, peer Peer, query string, withSnippet bool) ([]DocumentInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, peer.Timeout)
+	defer cancel()
+
+	target := fmt.Sprintf("%s/api/search?q=%s", peer.URL, url.QueryEscape(query))
+	if withSnippet {
+		target += "&snippet=1"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if peer.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding peer response: %w", err)
+	}
+	for i := range result.Results {
+		result.Results[i].Origin = peer.Name
+	}
+	return result.Results, nil
+}
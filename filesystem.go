@@ -0,0 +1,481 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RootType identifies what a FileSystem is backed by.
+type RootType string
+
+const (
+	RootTypeOS  RootType = "os"
+	RootTypeZip RootType = "zip"
+	RootTypeTar RootType = "tar"
+)
+
+// FileSystem abstracts the handful of filesystem operations the server
+// needs, so a document tree can be served from a plain directory, a zip
+// archive, or a tar.gz archive interchangeably. Paths are slash-separated
+// and rooted at "/", independent of the host OS.
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	RootType() RootType
+}
+
+// OpenFileSystem picks a FileSystem implementation for root based on its
+// extension: ".zip" is mounted as a zip archive, ".tar.gz"/".tgz" as a
+// tar.gz archive, anything else as a plain OS directory.
+func OpenFileSystem(root string) (FileSystem, error) {
+	lower := strings.ToLower(root)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return NewZipFileSystem(root)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return NewTarGzFileSystem(root)
+	default:
+		return NewOSFileSystem(root), nil
+	}
+}
+
+// osFS is a FileSystem backed by a real directory on disk.
+type osFS struct {
+	root string
+}
+
+// NewOSFileSystem returns a FileSystem rooted at root on the host disk.
+func NewOSFileSystem(root string) FileSystem {
+	return &osFS{root: root}
+}
+
+func (fsys *osFS) resolve(name string) string {
+	return filepath.Join(fsys.root, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (fsys *osFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(fsys.resolve(name))
+}
+
+func (fsys *osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(fsys.resolve(name))
+}
+
+func (fsys *osFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(fsys.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (fsys *osFS) RootType() RootType { return RootTypeOS }
+
+// archiveFileInfo implements os.FileInfo for entries synthesized from a
+// zip or tar.gz archive.
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (fi archiveFileInfo) Name() string { return fi.name }
+func (fi archiveFileInfo) Size() int64  { return fi.size }
+func (fi archiveFileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+func (fi archiveFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi archiveFileInfo) IsDir() bool        { return fi.isDir }
+func (fi archiveFileInfo) Sys() interface{}   { return nil }
+
+// archiveEntry is one file or directory inside an indexed archive.
+type archiveEntry struct {
+	info archiveFileInfo
+	open func() (io.ReadCloser, error) // nil for directories
+}
+
+// archiveTree is the shared representation used by zipFS and tarGzFS: a
+// flat index of every path in the archive plus the synthesized directory
+// listing for each directory (archives rarely carry explicit directory
+// entries for every level, so intermediate directories are inferred from
+// the file paths they contain).
+type archiveTree struct {
+	byPath   map[string]archiveEntry
+	children map[string][]os.FileInfo
+}
+
+func newArchiveTree() *archiveTree {
+	return &archiveTree{
+		byPath:   make(map[string]archiveEntry),
+		children: make(map[string][]os.FileInfo),
+	}
+}
+
+// add inserts a file entry and synthesizes any missing parent directories.
+func (t *archiveTree) add(name string, size int64, modTime time.Time, open func() (io.ReadCloser, error)) {
+	clean := path.Clean("/" + name)
+	t.addDirs(path.Dir(clean), modTime)
+	entry := archiveEntry{
+		info: archiveFileInfo{name: path.Base(clean), size: size, modTime: modTime},
+		open: open,
+	}
+	t.byPath[clean] = entry
+	t.appendChild(path.Dir(clean), entry.info)
+}
+
+// addDirs ensures every directory from "/" down to dir exists in the tree.
+func (t *archiveTree) addDirs(dir string, modTime time.Time) {
+	if dir == "/" || dir == "." {
+		if _, ok := t.byPath["/"]; !ok {
+			t.byPath["/"] = archiveEntry{info: archiveFileInfo{name: "/", isDir: true, modTime: modTime}}
+		}
+		return
+	}
+	if _, ok := t.byPath[dir]; ok {
+		return
+	}
+	t.addDirs(path.Dir(dir), modTime)
+	info := archiveFileInfo{name: path.Base(dir), isDir: true, modTime: modTime}
+	t.byPath[dir] = archiveEntry{info: info}
+	t.appendChild(path.Dir(dir), info)
+}
+
+func (t *archiveTree) appendChild(dir string, info os.FileInfo) {
+	for _, existing := range t.children[dir] {
+		if existing.Name() == info.Name() {
+			return
+		}
+	}
+	t.children[dir] = append(t.children[dir], info)
+}
+
+func (t *archiveTree) finish() {
+	t.addDirs("/", time.Time{})
+	for dir, infos := range t.children {
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		t.children[dir] = infos
+	}
+}
+
+// zipFS is a FileSystem backed by the contents of a zip archive.
+type zipFS struct {
+	r    *zip.ReadCloser
+	tree *archiveTree
+}
+
+// NewZipFileSystem opens archivePath as a zip archive and indexes its
+// contents so it can be browsed like a regular directory tree.
+func NewZipFileSystem(archivePath string) (FileSystem, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening zip archive %s: %w", archivePath, err)
+	}
+	zf := &zipFS{r: r, tree: newArchiveTree()}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		f := f
+		zf.tree.add(f.Name, int64(f.UncompressedSize64), f.Modified, func() (io.ReadCloser, error) {
+			return f.Open()
+		})
+	}
+	zf.tree.finish()
+	return zf, nil
+}
+
+func (z *zipFS) Open(name string) (io.ReadCloser, error) {
+	entry, ok := z.tree.byPath[path.Clean("/"+name)]
+	if !ok || entry.open == nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return entry.open()
+}
+
+func (z *zipFS) Lstat(name string) (os.FileInfo, error) {
+	entry, ok := z.tree.byPath[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return entry.info, nil
+}
+
+func (z *zipFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return z.tree.children[path.Clean("/"+name)], nil
+}
+
+func (z *zipFS) RootType() RootType { return RootTypeZip }
+
+// tarGzFS is a FileSystem backed by the contents of a tar.gz archive. The
+// underlying stream only supports sequential reads, so file contents are
+// buffered into memory at open time rather than re-read from the archive.
+type tarGzFS struct {
+	tree *archiveTree
+}
+
+// NewTarGzFileSystem opens archivePath as a gzip-compressed tar archive
+// and indexes its contents so it can be browsed like a regular directory
+// tree.
+func NewTarGzFileSystem(archivePath string) (FileSystem, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening tar.gz archive %s: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip header of %s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	tree := newArchiveTree()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar entry in %s: %w", archivePath, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading tar entry %s in %s: %w", hdr.Name, archivePath, err)
+		}
+		tree.add(hdr.Name, hdr.Size, hdr.ModTime, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		})
+	}
+	tree.finish()
+	return &tarGzFS{tree: tree}, nil
+}
+
+func (t *tarGzFS) Open(name string) (io.ReadCloser, error) {
+	entry, ok := t.tree.byPath[path.Clean("/"+name)]
+	if !ok || entry.open == nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return entry.open()
+}
+
+func (t *tarGzFS) Lstat(name string) (os.FileInfo, error) {
+	entry, ok := t.tree.byPath[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return entry.info, nil
+}
+
+func (t *tarGzFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return t.tree.children[path.Clean("/"+name)], nil
+}
+
+func (t *tarGzFS) RootType() RootType { return RootTypeTar }
+
+// mountedFS is one FileSystem bound into a NameSpace at a given mount
+// point.
+type mountedFS struct {
+	old string
+	fs  FileSystem
+}
+
+// NameSpace is a FileSystem formed by union-mounting other FileSystems
+// under URL-style prefixes, modeled after godoc's vfs.NameSpace: several
+// document roots (directories or archives) can be served under one
+// browsable tree. Later binds at the same mount point take priority.
+type NameSpace struct {
+	mounts map[string][]mountedFS
+}
+
+// NewNameSpace returns an empty NameSpace.
+func NewNameSpace() *NameSpace {
+	return &NameSpace{mounts: make(map[string][]mountedFS)}
+}
+
+// Bind mounts fsys under old, a slash-separated path such as "/" or
+// "/parts".
+func (ns *NameSpace) Bind(old string, fsys FileSystem) {
+	old = path.Clean("/" + old)
+	ns.mounts[old] = append([]mountedFS{{old: old, fs: fsys}}, ns.mounts[old]...)
+}
+
+// resolve finds the longest mount point that is name itself or an
+// ancestor of it and returns, in priority order, the mounts bound there,
+// together with the path to look up inside each one. Mounts at shorter
+// ancestor mount points are not consulted.
+func (ns *NameSpace) resolve(name string) []struct {
+	fs   FileSystem
+	path string
+} {
+	clean := path.Clean("/" + name)
+	var best string
+	for old := range ns.mounts {
+		if old == "/" || clean == old || strings.HasPrefix(clean, old+"/") {
+			if len(old) > len(best) {
+				best = old
+			}
+		}
+	}
+	if best == "" {
+		best = "/"
+	}
+	sub := strings.TrimPrefix(clean, best)
+	if sub == "" {
+		sub = "/"
+	}
+	candidates := make([]struct {
+		fs   FileSystem
+		path string
+	}, 0, len(ns.mounts[best]))
+	for _, m := range ns.mounts[best] {
+		candidates = append(candidates, struct {
+			fs   FileSystem
+			path string
+		}{fs: m.fs, path: sub})
+	}
+	return candidates
+}
+
+func (ns *NameSpace) Open(name string) (io.ReadCloser, error) {
+	var lastErr error
+	for _, c := range ns.resolve(name) {
+		rc, err := c.fs.Open(c.path)
+		if err == nil {
+			return rc, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return nil, lastErr
+}
+
+func (ns *NameSpace) Lstat(name string) (os.FileInfo, error) {
+	if path.Clean("/"+name) == "/" {
+		return archiveFileInfo{name: "/", isDir: true}, nil
+	}
+	var lastErr error
+	for _, c := range ns.resolve(name) {
+		info, err := c.fs.Lstat(c.path)
+		if err == nil {
+			return info, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return nil, lastErr
+}
+
+// ReadDir merges the directory listing across every mount that applies to
+// name, so two document roots bound under the same prefix appear as one
+// union of folders and files. Mounts bound directly under name at a
+// non-root prefix (e.g. "-mount /parts=...") are surfaced as a synthetic
+// directory entry even though they don't exist as a real child of any
+// individual mount's own filesystem, the way godoc's vfs.NameSpace does.
+func (ns *NameSpace) ReadDir(name string) ([]os.FileInfo, error) {
+	clean := path.Clean("/" + name)
+	seen := make(map[string]bool)
+	var merged []os.FileInfo
+	var lastErr error
+	found := false
+	for _, c := range ns.resolve(name) {
+		entries, err := c.fs.ReadDir(c.path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+		for _, e := range entries {
+			if seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			merged = append(merged, e)
+		}
+	}
+
+	for old := range ns.mounts {
+		if old == "/" || old == clean || path.Dir(old) != clean {
+			continue
+		}
+		child := path.Base(old)
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		merged = append(merged, archiveFileInfo{name: child, isDir: true})
+		found = true
+	}
+
+	if !found {
+		if lastErr == nil {
+			lastErr = &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+		}
+		return nil, lastErr
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+func (ns *NameSpace) RootType() RootType { return RootTypeOS }
+
+// WalkFS walks fsys starting at root, calling fn for every file and
+// directory encountered (root included), depth-first. It is the
+// FileSystem-interface equivalent of filepath.Walk.
+func WalkFS(fsys FileSystem, root string, fn func(path string, info os.FileInfo) error) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		return err
+	}
+	return walkFS(fsys, root, info, fn)
+}
+
+func walkFS(fsys FileSystem, p string, info os.FileInfo, fn func(string, os.FileInfo) error) error {
+	if err := fn(p, info); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := fsys.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		childPath := path.Join(p, e.Name())
+		if err := walkFS(fsys, childPath, e, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"html/template"
-	"io/fs"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/piek-motors/public_docs_server/auth"
 )
 
 // FileInfo represents a file or directory in the table of contents
@@ -37,9 +41,38 @@ type DirectoryData struct {
 	ScanTime    time.Time  `json:"scan_time"`
 }
 
+// mountFlag collects repeated -mount flags of the form "/url/prefix=path".
+type mountFlag []string
+
+func (m *mountFlag) String() string { return strings.Join(*m, ",") }
+func (m *mountFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// browseRoot is the URL prefix every document-browsing request is served
+// under; "/browse@<ref>/..." pins the view to a specific git revision via
+// s.docSet, "/browse/..." browses the live primary checkout.
+const browseRoot = "/browse"
+
 type Server struct {
 	scannedPath string
 	port        string
+	fsys        *NameSpace
+	index       *DocumentIndex
+	federator   *Federator
+	docSet      *DocSet
+
+	// pathFilter, if non-nil, is consulted for every browse/serve/search
+	// call to decide whether the resolved virtual path is visible to the
+	// current user; nil means no policy is configured and everything is
+	// visible.
+	pathFilter auth.FilterFunc
+	// authenticate resolves HTTP Basic Auth credentials to a *User; nil
+	// means no login is configured and every request is anonymous.
+	authenticate func(username, password string) (*auth.User, bool)
+	// shareSecret signs and verifies "/share/<token>" links.
+	shareSecret []byte
 }
 
 func NewServer() *Server {
@@ -50,30 +83,285 @@ func NewServer() *Server {
 
 func (s *Server) initialize() error {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	if len(os.Args) > 1 {
-		s.scannedPath = os.Args[1]
-	} else {
-		return fmt.Errorf("no path provided")
-	}
-	if _, err := os.Stat(s.scannedPath); os.IsNotExist(err) {
-		return fmt.Errorf("directory does not exist: %s", s.scannedPath)
+
+	var root string
+	var mounts mountFlag
+	var federationConfigPath string
+	var gitRepo string
+	var gitCacheDir string
+	var gitFetchInterval time.Duration
+	var gitMaxWorktrees int
+	var policyPath string
+	var shareSecret string
+	flag.StringVar(&root, "root", "", "primary document root to scan (a directory, .zip, or .tar.gz)")
+	flag.Var(&mounts, "mount", "additional root to union-mount, as /url/prefix=path (directory, .zip, or .tar.gz); may be repeated")
+	flag.StringVar(&federationConfigPath, "federation-config", "", "JSON file listing peer public_docs_server instances to federate search across")
+	flag.StringVar(&gitRepo, "git-repo", "", "git remote (or local path) to serve as a DocSet instead of -root, enabling /browse@<ref>/... revision browsing")
+	flag.StringVar(&gitCacheDir, "git-cache-dir", filepath.Join(os.TempDir(), "public_docs_server_docset"), "directory the primary checkout and on-demand worktrees are kept in")
+	flag.DurationVar(&gitFetchInterval, "git-fetch-interval", 5*time.Minute, "how often to fetch the primary checkout from origin")
+	flag.IntVar(&gitMaxWorktrees, "git-max-worktrees", 5, "maximum number of on-demand per-revision worktrees kept checked out at once")
+	flag.StringVar(&policyPath, "policy", "", "YAML access-control policy file restricting visible directories and listing login credentials")
+	flag.StringVar(&shareSecret, "share-secret", "", "HMAC secret signing /share/<token> links; sharing is disabled if empty")
+	flag.Parse()
+
+	if root == "" && gitRepo == "" && flag.NArg() > 0 {
+		root = flag.Arg(0)
+	}
+
+	ns := NewNameSpace()
+
+	switch {
+	case gitRepo != "":
+		docSet, err := NewDocSet(gitRepo, gitCacheDir, gitMaxWorktrees)
+		if err != nil {
+			return fmt.Errorf("setting up git document set: %v", err)
+		}
+		s.docSet = docSet
+		s.scannedPath = docSet.PrimaryDir()
+		ns.Bind("/", NewOSFileSystem(docSet.PrimaryDir()))
+		docSet.StartAutoFetch(gitFetchInterval, func() {
+			s.index.ForceRefresh(s.fsys, "/")
+		})
+	case root != "":
+		absPath, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("error getting absolute path: %v", err)
+		}
+		s.scannedPath = absPath
+		rootFS, err := OpenFileSystem(s.scannedPath)
+		if err != nil {
+			return fmt.Errorf("opening document root %s: %v", s.scannedPath, err)
+		}
+		ns.Bind("/", rootFS)
+	default:
+		return fmt.Errorf("no document root provided (use -root, -git-repo, or a positional argument)")
 	}
-	absPath, err := filepath.Abs(s.scannedPath)
-	if err != nil {
-		return fmt.Errorf("error getting absolute path: %v", err)
+
+	for _, m := range mounts {
+		prefix, src, ok := strings.Cut(m, "=")
+		if !ok {
+			return fmt.Errorf("invalid -mount %q, expected /url/prefix=path", m)
+		}
+		mountFS, err := OpenFileSystem(src)
+		if err != nil {
+			return fmt.Errorf("opening mount %s: %v", src, err)
+		}
+		ns.Bind(prefix, mountFS)
+		log.Printf("Mounted %s at %s", src, prefix)
 	}
-	s.scannedPath = absPath
+	s.fsys = ns
+
 	log.Printf("Starting directory scanner for: %s", s.scannedPath)
 	log.Printf("Server will be available at: http://localhost%s", s.port)
+
+	indexFile := filepath.Join(os.TempDir(), "public_docs_server_index.gob")
+	s.index = NewDocumentIndex(indexFile)
+	s.index.StartIndexing(s.fsys, "/")
+
+	localName, err := os.Hostname()
+	if err != nil || localName == "" {
+		localName = "local"
+	}
+	var peers []Peer
+	if federationConfigPath != "" {
+		cfg, err := LoadFederationConfig(federationConfigPath)
+		if err != nil {
+			return fmt.Errorf("loading federation config: %v", err)
+		}
+		peers = cfg.Peers
+		log.Printf("Federating search across %d peer(s)", len(peers))
+	}
+	s.federator = NewFederator(s.index, localName, peers)
+
+	if policyPath != "" {
+		policy, err := auth.LoadPolicy(policyPath)
+		if err != nil {
+			return fmt.Errorf("loading access policy: %v", err)
+		}
+		s.pathFilter = policy.Filter()
+		s.authenticate = policy.Authenticate
+		log.Printf("Access policy loaded from %s (%d rule(s), %d user(s))", policyPath, len(policy.Rules), len(policy.Users))
+	}
+	s.shareSecret = []byte(shareSecret)
+
 	return nil
 }
 
 func (s *Server) setupRoutes(r *gin.Engine) {
-	r.GET("/*path", s.handleBrowse)
+	r.GET("/api/search", s.handleSearch)
+	r.GET("/api/federated-search", s.handleFederatedSearch)
+	r.GET("/share/:token", s.handleShare)
+	r.GET("/api/share", s.handleCreateShare)
+	// handleBrowse serves everything else (directory listings and files),
+	// so it must be the fallback rather than a competing wildcard route.
+	r.NoRoute(s.handleBrowse)
+}
+
+// currentUser resolves the *User for c's HTTP Basic Auth credentials, or
+// nil (anonymous) if no login is configured or they don't match.
+func (s *Server) currentUser(c *gin.Context) *auth.User {
+	if s.authenticate == nil {
+		return nil
+	}
+	return auth.UserFromRequest(c.Request, s.authenticate)
+}
+
+// isPathAllowed reports whether virtualPath is visible to user, per the
+// configured access policy. No policy configured means everything is
+// visible.
+func (s *Server) isPathAllowed(virtualPath string, user *auth.User) bool {
+	if s.pathFilter == nil {
+		return true
+	}
+	return s.pathFilter(virtualPath, user)
+}
+
+// accessFilter adapts isPathAllowed into the func(fullPath string) bool
+// shape SearchDocuments/SearchContent/FederatedSearch expect, returning
+// nil (no restriction) when no policy is configured.
+func (s *Server) accessFilter(user *auth.User) func(string) bool {
+	if s.pathFilter == nil {
+		return nil
+	}
+	return func(virtualPath string) bool { return s.pathFilter(virtualPath, user) }
+}
+
+func (s *Server) handleSearch(c *gin.Context) {
+	query := c.Query("q")
+	withSnippet := c.Query("snippet") == "1"
+	user := s.currentUser(c)
+	c.JSON(http.StatusOK, s.index.SearchContent(query, withSnippet, s.accessFilter(user)))
+}
+
+func (s *Server) handleFederatedSearch(c *gin.Context) {
+	query := c.Query("q")
+	withSnippet := c.Query("snippet") == "1"
+	user := s.currentUser(c)
+	c.JSON(http.StatusOK, s.federator.FederatedSearch(c.Request.Context(), query, withSnippet, s.accessFilter(user)))
+}
+
+// handleShare serves the single file named by a signed "/share/<token>"
+// link, bypassing the login/policy check since the token itself is the
+// grant; it never allows directory listing or traversal beyond the one
+// path it was signed for.
+func (s *Server) handleShare(c *gin.Context) {
+	if len(s.shareSecret) == 0 {
+		c.String(http.StatusNotFound, "Sharing is not configured")
+		return
+	}
+
+	payload, err := auth.VerifyShareLink(c.Param("token"), s.shareSecret)
+	if err != nil {
+		c.String(http.StatusForbidden, "Invalid or expired share link: %v", err)
+		return
+	}
+
+	info, err := s.fsys.Lstat(payload.Path)
+	if err != nil || info.IsDir() {
+		c.String(http.StatusNotFound, "Path not found")
+		return
+	}
+
+	if payload.DownloadOnly {
+		c.Header("Content-Disposition", "attachment; filename="+path.Base(payload.Path))
+	}
+	if err := s.serveFile(c, s.fsys, browseRoot, payload.Path, info); err != nil {
+		c.String(http.StatusInternalServerError, "Error serving file: %v", err)
+	}
+}
+
+// handleCreateShare lets a user who can already see a path mint a signed
+// "/share/<token>" link for it, good for ttl (default 24h), optionally
+// restricted to download rather than inline viewing. Login is required to
+// call this whenever a login is configured at all, so share links can't
+// be minted for paths the caller can't otherwise see.
+func (s *Server) handleCreateShare(c *gin.Context) {
+	if len(s.shareSecret) == 0 {
+		c.String(http.StatusNotFound, "Sharing is not configured")
+		return
+	}
+
+	user := s.currentUser(c)
+	if s.authenticate != nil && user == nil {
+		c.Header("WWW-Authenticate", `Basic realm="public_docs_server"`)
+		c.String(http.StatusUnauthorized, "Login required to create a share link")
+		return
+	}
+
+	virtualPath := path.Clean("/" + c.Query("path"))
+	if !s.isPathAllowed(virtualPath, user) {
+		c.String(http.StatusForbidden, "Access denied")
+		return
+	}
+	info, err := s.fsys.Lstat(virtualPath)
+	if err != nil || info.IsDir() {
+		c.String(http.StatusNotFound, "Path not found: %v", err)
+		return
+	}
+
+	ttl := 24 * time.Hour
+	if raw := c.Query("ttl"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid ttl %q: %v", raw, err)
+			return
+		}
+		ttl = parsed
+	}
+
+	token, err := auth.SignShareLink(auth.SharePayload{
+		Path:         virtualPath,
+		Expiry:       time.Now().Add(ttl),
+		DownloadOnly: c.Query("download") == "1",
+	}, s.shareSecret)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error creating share link: %v", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": "/share/" + token})
+}
+
+// splitBrowsePath pulls the optional "@<ref>" revision pin off a request
+// path under browseRoot and returns it together with the remaining
+// virtual path to resolve inside that revision's tree. A request outside
+// browseRoot is passed through unchanged with an empty ref.
+func splitBrowsePath(requestedPath string) (ref, subPath string) {
+	switch {
+	case requestedPath == browseRoot:
+		return "", "/"
+	case strings.HasPrefix(requestedPath, browseRoot+"@"):
+		rest := requestedPath[len(browseRoot)+1:]
+		refPart, sub, found := strings.Cut(rest, "/")
+		if !found {
+			return refPart, "/"
+		}
+		return refPart, "/" + sub
+	case strings.HasPrefix(requestedPath, browseRoot+"/"):
+		return "", strings.TrimPrefix(requestedPath, browseRoot)
+	default:
+		return "", requestedPath
+	}
+}
+
+// resolveFileSystem returns the FileSystem a request pinned to ref should
+// be served from, together with the URL prefix links within that view
+// should be generated under. An empty ref (or no configured DocSet) uses
+// the regular mounted NameSpace; any other ref is resolved to an on-demand
+// git worktree and served directly off disk, bypassing extra mounts.
+func (s *Server) resolveFileSystem(ref string) (FileSystem, string, error) {
+	if ref == "" || s.docSet == nil {
+		return s.fsys, browseRoot, nil
+	}
+	dir, err := s.docSet.Resolve(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	return NewOSFileSystem(dir), browseRoot + "@" + ref, nil
 }
 
 func (s *Server) handleBrowse(c *gin.Context) {
-	requestedPath := c.Param("path")
+	requestedPath := c.Request.URL.Path
 
 	if strings.HasPrefix(requestedPath, "/static/") {
 		staticPath := "." + requestedPath
@@ -86,38 +374,47 @@ func (s *Server) handleBrowse(c *gin.Context) {
 		return
 	}
 
-	cleanedPath := strings.TrimPrefix(requestedPath, "/")
-	fullPath := filepath.Join(s.scannedPath, cleanedPath)
+	ref, subPath := splitBrowsePath(requestedPath)
+	virtualPath := path.Clean(subPath)
+
+	fsys, browsePrefix, err := s.resolveFileSystem(ref)
+	if err != nil {
+		c.String(http.StatusNotFound, "Unknown revision %q: %v", ref, err)
+		return
+	}
 
-	if !s.isPathAllowed(fullPath) {
+	user := s.currentUser(c)
+	if !s.isPathAllowed(virtualPath, user) {
 		c.String(http.StatusForbidden, "Access denied")
 		return
 	}
 
-	info, err := os.Stat(fullPath)
+	info, err := fsys.Lstat(virtualPath)
 	if err != nil {
 		c.String(http.StatusNotFound, "Path not found: %v", err)
 		return
 	}
 
 	if !info.IsDir() {
-		s.serveFile(c, fullPath)
+		if err := s.serveFile(c, fsys, browsePrefix, virtualPath, info); err != nil {
+			c.String(http.StatusInternalServerError, "Error serving file: %v", err)
+		}
 		return
 	}
 
-	data, err := s.scanDirectory(fullPath)
+	data, err := s.scanDirectory(fsys, virtualPath, user)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Error scanning directory: %v", err)
 		return
 	}
 
-	relPath, _ := filepath.Rel(s.scannedPath, fullPath)
-	breadcrumb := s.createBreadcrumb(relPath)
+	breadcrumb := s.createBreadcrumb(browsePrefix, virtualPath)
 
 	templateData := gin.H{
-		"Title":      "Публичные документы",
-		"Data":       data,
-		"Breadcrumb": breadcrumb,
+		"Title":        "Публичные документы",
+		"Data":         data,
+		"Breadcrumb":   breadcrumb,
+		"BrowsePrefix": browsePrefix,
 	}
 
 	tmpl, err := template.New("index").Parse(htmlTemplate)
@@ -133,62 +430,92 @@ func (s *Server) handleBrowse(c *gin.Context) {
 	}
 }
 
-func (s *Server) isPathAllowed(path string) bool {
-	return strings.HasPrefix(path, s.scannedPath)
-}
+func (s *Server) serveFile(c *gin.Context, fsys FileSystem, browsePrefix, virtualPath string, info os.FileInfo) error {
+	ext := strings.ToLower(path.Ext(virtualPath))
+	if ext == ".md" && c.Query("raw") != "1" {
+		return s.serveMarkdown(c, fsys, browsePrefix, virtualPath)
+	}
 
-func (s *Server) serveFile(c *gin.Context, fullPath string) error {
-	info, err := os.Stat(fullPath)
+	rc, err := fsys.Open(virtualPath)
 	if err != nil {
-		return fmt.Errorf("file not found")
-	}
-	if info.IsDir() {
-		return fmt.Errorf("cannot view directory")
+		return fmt.Errorf("file not found: %v", err)
 	}
-	ext := strings.ToLower(filepath.Ext(fullPath))
+	defer rc.Close()
+
+	contentType := "application/octet-stream"
 	if ext == ".pdf" {
-		c.Header("Content-Type", "application/pdf")
-		c.Header("Content-Disposition", "inline; filename="+filepath.Base(fullPath))
+		contentType = "application/pdf"
+		if c.Writer.Header().Get("Content-Disposition") == "" {
+			c.Header("Content-Disposition", "inline; filename="+path.Base(virtualPath))
+		}
 	}
-	c.File(fullPath)
+	if ext == ".md" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	c.DataFromReader(http.StatusOK, info.Size(), contentType, rc, nil)
 	return nil
 }
 
-func (s *Server) scanDirectory(dirPath string) (*DirectoryData, error) {
-	absPath, err := filepath.Abs(dirPath)
+// serveMarkdown renders virtualPath as HTML via RenderMarkdown, alongside
+// its heading table of contents. ?raw=1 bypasses this and serves the
+// markdown source as plain text instead (handled by the caller).
+func (s *Server) serveMarkdown(c *gin.Context, fsys FileSystem, browsePrefix, virtualPath string) error {
+	rc, err := fsys.Open(virtualPath)
 	if err != nil {
-		return nil, fmt.Errorf("error getting absolute path: %v", err)
+		return fmt.Errorf("file not found: %v", err)
 	}
-	if err := s.validateDirectory(absPath); err != nil {
-		return nil, err
+	defer rc.Close()
+
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("reading markdown: %v", err)
 	}
 
-	var files []FileInfo
-	var directories []FileInfo
-	entries, err := os.ReadDir(absPath)
+	body, toc, err := RenderMarkdown(raw, virtualPath, browsePrefix)
+	if err != nil {
+		return fmt.Errorf("rendering markdown: %v", err)
+	}
+
+	tmpl, err := template.New("markdown").Parse(markdownTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing markdown template: %v", err)
+	}
+
+	c.Header("Content-Type", "text/html")
+	return tmpl.Execute(c.Writer, gin.H{
+		"Title":  path.Base(virtualPath),
+		"Body":   template.HTML(body),
+		"TOC":    toc,
+		"RawURL": browsePrefix + virtualPath + "?raw=1",
+	})
+}
+
+// scanDirectory lists dirPath's entries, dropping any child the policy
+// hides from user so restricted subdirectories and files never surface in
+// a listing even when the parent directory itself is visible.
+func (s *Server) scanDirectory(fsys FileSystem, dirPath string, user *auth.User) (*DirectoryData, error) {
+	entries, err := fsys.ReadDir(dirPath)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, d := range entries {
-		path := filepath.Join(absPath, d.Name())
-		fileInfo, err := s.createFileInfo(path, d)
-		if err != nil {
-			return nil, err
+	var files []FileInfo
+	var directories []FileInfo
+	for _, e := range entries {
+		childPath := path.Join(dirPath, e.Name())
+		if !s.isPathAllowed(childPath, user) {
+			continue
 		}
-		if d.IsDir() {
+		fileInfo := s.createFileInfo(childPath, e)
+		if e.IsDir() {
 			directories = append(directories, fileInfo)
 		} else {
 			files = append(files, fileInfo)
 		}
 	}
 
-	if absPath == s.scannedPath {
-		// files = []FileInfo{} - This logic is no longer needed with server-side rendering
-	}
-
 	s.sortFileLists(files, directories)
-	relPath := s.getRelativePath(absPath)
+	relPath := s.getRelativePath(dirPath)
 	return &DirectoryData{
 		Path:        relPath,
 		Files:       files,
@@ -199,41 +526,20 @@ func (s *Server) scanDirectory(dirPath string) (*DirectoryData, error) {
 	}, nil
 }
 
-func (s *Server) validateDirectory(absPath string) error {
-	info, err := os.Stat(absPath)
-	if err != nil {
-		return fmt.Errorf("error accessing path: %v", err)
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("path is not a directory: %s", absPath)
-	}
-	return nil
-}
-
-func (s *Server) createFileInfo(path string, d fs.DirEntry) (FileInfo, error) {
-	relPath, err := filepath.Rel(s.scannedPath, path)
-	if err != nil {
-		return FileInfo{}, err
-	}
-	info, err := d.Info()
-	if err != nil {
-		return FileInfo{}, err
-	}
+func (s *Server) createFileInfo(virtualPath string, info os.FileInfo) FileInfo {
 	fileInfo := FileInfo{
-		Name:         d.Name(),
-		Path:         path,
-		IsDir:        d.IsDir(),
+		Name:         info.Name(),
+		Path:         virtualPath,
+		IsDir:        info.IsDir(),
 		Size:         info.Size(),
 		ModTime:      info.ModTime(),
-		RelativePath: relPath,
+		RelativePath: strings.TrimPrefix(virtualPath, "/"),
 	}
-	if !d.IsDir() {
-		fileInfo.Extension = strings.ToLower(filepath.Ext(d.Name()))
+	if !info.IsDir() {
+		fileInfo.Extension = strings.ToLower(path.Ext(info.Name()))
 		fileInfo.CanView = s.canViewFile(fileInfo.Extension)
-	} else {
-		fileInfo.CanView = false
 	}
-	return fileInfo, nil
+	return fileInfo
 }
 
 func (s *Server) sortFileLists(files []FileInfo, directories []FileInfo) {
@@ -245,9 +551,9 @@ func (s *Server) sortFileLists(files []FileInfo, directories []FileInfo) {
 	})
 }
 
-func (s *Server) getRelativePath(absPath string) string {
-	relPath, _ := filepath.Rel(s.scannedPath, absPath)
-	if relPath == "." {
+func (s *Server) getRelativePath(virtualPath string) string {
+	relPath := strings.TrimPrefix(virtualPath, "/")
+	if relPath == "" {
 		relPath = "Root"
 	}
 	return relPath
@@ -286,17 +592,19 @@ type BreadcrumbPart struct {
 	Path string
 }
 
-func (s *Server) createBreadcrumb(path string) []BreadcrumbPart {
+func (s *Server) createBreadcrumb(browsePrefix, virtualPath string) []BreadcrumbPart {
 	var parts []BreadcrumbPart
-	parts = append(parts, BreadcrumbPart{Name: "Главная", Path: "/"})
-	if path == "." || path == "" {
+	parts = append(parts, BreadcrumbPart{Name: "Главная", Path: browsePrefix})
+
+	trimmed := strings.Trim(virtualPath, "/")
+	if trimmed == "" {
 		return parts
 	}
 
 	currentPath := ""
-	for _, part := range strings.Split(path, "/") {
-		currentPath = filepath.Join(currentPath, part)
-		parts = append(parts, BreadcrumbPart{Name: part, Path: "/" + currentPath})
+	for _, part := range strings.Split(trimmed, "/") {
+		currentPath = currentPath + "/" + part
+		parts = append(parts, BreadcrumbPart{Name: part, Path: browsePrefix + currentPath})
 	}
 	return parts
-} 
\ No newline at end of file
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// TableOfContents is one heading entry extracted from a rendered markdown
+// document, used to build the sidebar next to it.
+type TableOfContents struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// markdownConverter intentionally does NOT set html.WithUnsafe(): the
+// document tree can contain files from any mounted archive, docset
+// revision, or share link, so raw HTML/script embedded in a .md file must
+// be dropped rather than passed through to the rendered page. GFM tables
+// and strikethrough don't require it.
+var markdownConverter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// RenderMarkdown converts raw (GFM) markdown to HTML, returning the
+// rendered body and its heading-derived TableOfContents. Relative links
+// (e.g. "../other.md") are rewritten against virtualPath's directory so
+// they keep resolving through browsePrefix rather than breaking out of
+// the browse tree.
+func RenderMarkdown(raw []byte, virtualPath, browsePrefix string) (string, []TableOfContents, error) {
+	doc := markdownConverter.Parser().Parse(text.NewReader(raw))
+
+	toc := extractTOC(doc, raw)
+	rewriteRelativeLinks(doc, virtualPath, browsePrefix)
+
+	var buf bytes.Buffer
+	if err := markdownConverter.Renderer().Render(&buf, raw, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), toc, nil
+}
+
+// extractTOC walks the parsed document collecting every heading in
+// document order.
+func extractTOC(doc ast.Node, source []byte) []TableOfContents {
+	var toc []TableOfContents
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		var text strings.Builder
+		for c := heading.FirstChild(); c != nil; c = c.NextSibling() {
+			if t, ok := c.(*ast.Text); ok {
+				text.Write(t.Segment.Value(source))
+			}
+		}
+
+		var id string
+		if raw, ok := heading.AttributeString("id"); ok {
+			if b, ok := raw.([]byte); ok {
+				id = string(b)
+			}
+		}
+
+		toc = append(toc, TableOfContents{Level: heading.Level, Text: text.String(), ID: id})
+		return ast.WalkContinue, nil
+	})
+	return toc
+}
+
+// rewriteRelativeLinks resolves every non-external link destination
+// against virtualPath's directory and rewrites it to go through
+// browsePrefix, so "../other.md" from /browse/docs/a.md still resolves
+// to /browse/other.md instead of a bare filesystem path.
+func rewriteRelativeLinks(doc ast.Node, virtualPath, browsePrefix string) {
+	dir := path.Dir(virtualPath)
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		link, ok := n.(*ast.Link)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		dest := string(link.Destination)
+		if isExternalLink(dest) {
+			return ast.WalkContinue, nil
+		}
+		resolved := path.Clean(path.Join(dir, dest))
+		link.Destination = []byte(browsePrefix + resolved)
+		return ast.WalkContinue, nil
+	})
+}
+
+func isExternalLink(dest string) bool {
+	return dest == "" ||
+		strings.Contains(dest, "://") ||
+		strings.HasPrefix(dest, "#") ||
+		strings.HasPrefix(dest, "mailto:")
+}
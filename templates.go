@@ -25,18 +25,18 @@ const htmlTemplate = `<!DOCTYPE html>
         <div class="breadcrumb">
             {{range $i, $part := .Breadcrumb}}
                 {{if $i}} / {{end}}
-                <a href="/browse{{$part.Path}}">{{$part.Name}}</a>
+                <a href="{{$part.Path}}">{{$part.Name}}</a>
             {{end}}
         </div>
-        
+
         <div class="content">
             {{if .Data.Directories}}
             <div class="section" id="directories-section">
                 <h2>Папки</h2>
                 <ul class="file-list">
-                    {{range .Data.Directories}}
+                    {{range $.Data.Directories}}
                     <li class="file-item directory">
-                        <a href="/browse/{{.RelativePath}}" class="file-link">
+                        <a href="{{$.BrowsePrefix}}/{{.RelativePath}}" class="file-link">
                             <div class="file-info">
                                 <div class="file-name">📁 {{.Name}}</div>
                             </div>
@@ -51,11 +51,11 @@ const htmlTemplate = `<!DOCTYPE html>
             <div class="section" id="files-section">
                 <h2>Документы</h2>
                 <ul class="file-list">
-                    {{range .Data.Files}}
+                    {{range $.Data.Files}}
                      <li class="file-item">
-                        <a href="/browse/{{.RelativePath}}" class="file-link" target="_blank">
+                        <a href="{{$.BrowsePrefix}}/{{.RelativePath}}" class="file-link" target="_blank">
                             <div class="file-info">
-                                <div class="file-name">{{.Name}}</div>
+                                <div class="file-name">{{if eq .Extension ".md"}}📝{{else}}📄{{end}} {{.Name}}</div>
                                 <div class="file-details">
                                     <span>{{.ModTime.Format "02.01.2006"}}</span>
                                 </div>
@@ -85,5 +85,84 @@ const htmlTemplate = `<!DOCTYPE html>
         </div>
     </div>
     <script src="/static/js/main.js"></script>
+    <script>
+    (function() {
+        var form = document.getElementById('searchForm');
+        var input = document.getElementById('searchInput');
+        var results = document.getElementById('searchResults');
+        if (!form) return;
+        form.addEventListener('submit', function(e) {
+            e.preventDefault();
+            var q = input.value.trim();
+            if (!q) return;
+            fetch('/api/search?q=' + encodeURIComponent(q) + '&snippet=1')
+                .then(function(r) { return r.json(); })
+                .then(function(data) {
+                    results.innerHTML = '';
+                    if (!data.results || data.results.length === 0) {
+                        results.innerHTML = '<p class="empty-state">Ничего не найдено</p>';
+                        return;
+                    }
+                    data.results.forEach(function(hit) {
+                        var item = document.createElement('div');
+                        item.className = 'search-result-item';
+
+                        var link = document.createElement('a');
+                        link.href = '/browse/' + hit.relative_path;
+                        link.target = '_blank';
+                        link.textContent = hit.name; // names come from disk; never treat as HTML
+                        item.appendChild(link);
+
+                        if (hit.snippet) {
+                            var snippet = document.createElement('div');
+                            snippet.className = 'search-snippet';
+                            // server already HTML-escapes the snippet text and only adds <mark> itself
+                            snippet.innerHTML = hit.snippet;
+                            item.appendChild(snippet);
+                        }
+
+                        results.appendChild(item);
+                    });
+                });
+        });
+    })();
+    </script>
+</body>
+</html>`
+
+// markdownTemplate renders a .md document as HTML with a heading-derived
+// table of contents sidebar. See Server.serveMarkdown.
+const markdownTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <link rel="stylesheet" href="/static/css/main.css">
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📝 {{.Title}}</h1>
+            <a href="{{.RawURL}}">Исходный текст</a>
+        </div>
+
+        <div class="markdown-page">
+            {{if .TOC}}
+            <nav class="markdown-toc">
+                <h2>Содержание</h2>
+                <ul>
+                    {{range .TOC}}
+                    <li class="toc-level-{{.Level}}"><a href="#{{.ID}}">{{.Text}}</a></li>
+                    {{end}}
+                </ul>
+            </nav>
+            {{end}}
+
+            <article class="markdown-body">
+                {{.Body}}
+            </article>
+        </div>
+    </div>
 </body>
-</html>` 
\ No newline at end of file
+</html>`